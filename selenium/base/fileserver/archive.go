@@ -0,0 +1,93 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+)
+
+// handleArchive serves GET /?archive=zip|tar.gz&path=<subdir>, streaming
+// the requested subtree straight to w without staging it on disk first.
+func handleArchive(w http.ResponseWriter, r *http.Request, backend StorageBackend) {
+	format := r.URL.Query().Get("archive")
+	prefix := r.URL.Query().Get("path")
+
+	files, err := backend.ListRecursive(prefix)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	switch format {
+	case "zip":
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="archive.zip"`)
+		if err := writeZipArchive(w, backend, files); err != nil {
+			log.Printf("failed to stream zip archive: %v", err)
+		}
+	case "tar.gz":
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", `attachment; filename="archive.tar.gz"`)
+		if err := writeTarGzArchive(w, backend, files); err != nil {
+			log.Printf("failed to stream tar.gz archive: %v", err)
+		}
+	default:
+		http.Error(w, fmt.Sprintf("unsupported archive format %q", format), http.StatusBadRequest)
+	}
+}
+
+func writeZipArchive(w http.ResponseWriter, backend StorageBackend, files []FileMeta) error {
+	zw := zip.NewWriter(w)
+	defer zw.Close()
+
+	for _, f := range files {
+		fw, err := zw.Create(f.Name)
+		if err != nil {
+			return err
+		}
+		if err := copyFileInto(backend, f.Name, fw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeTarGzArchive(w http.ResponseWriter, backend StorageBackend, files []FileMeta) error {
+	gw := gzip.NewWriter(w)
+	defer gw.Close()
+	tw := tar.NewWriter(gw)
+	defer tw.Close()
+
+	for _, f := range files {
+		hdr := &tar.Header{
+			Name:    f.Name,
+			Size:    f.Size,
+			Mode:    0644,
+			ModTime: f.ModTime,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if err := copyFileInto(backend, f.Name, tw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyFileInto(backend StorageBackend, name string, w io.Writer) error {
+	r, err := backend.Get(name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	buf := hashBufPool.Get().(*[]byte)
+	defer hashBufPool.Put(buf)
+	_, err = io.CopyBuffer(w, r, *buf)
+	return err
+}
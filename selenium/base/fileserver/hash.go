@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/zeebo/blake3"
+)
+
+// hashRegistry lists every algorithm accepted by the ?hash= query param.
+// Add an entry here to support a new one; no other code needs to change.
+var hashRegistry = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+	"xxh64":  func() hash.Hash { return xxhash.New() },
+	"blake3": func() hash.Hash { return blake3.New() },
+}
+
+func NewHash(algo string) hash.Hash {
+	ctor, ok := hashRegistry[strings.ToLower(algo)]
+	if !ok {
+		return nil
+	}
+	return ctor()
+}
+
+// splitAlgos parses a comma-separated ?hash= value into its normalized,
+// non-empty algorithm names.
+func splitAlgos(algoList string) []string {
+	var algos []string
+	for _, algo := range strings.Split(algoList, ",") {
+		algo = strings.ToLower(strings.TrimSpace(algo))
+		if algo != "" {
+			algos = append(algos, algo)
+		}
+	}
+	return algos
+}
+
+// getHashes computes every algorithm in algoList (a comma-separated
+// ?hash= value) for entry, reusing cached digests where possible and
+// hashing the file at most once for whatever's left over by wrapping all
+// the missing hashers in a single io.MultiWriter.
+func getHashes(backend StorageBackend, cache *HashCache, entry FileMeta, algoList string) (map[string]string, error) {
+	algos := splitAlgos(algoList)
+	if len(algos) == 0 {
+		return nil, nil
+	}
+	modTime := entry.ModTime.Unix()
+
+	result := make(map[string]string)
+	hashers := make(map[string]hash.Hash)
+	for _, algo := range algos {
+		if digest, ok := cache.Get(entry.Name, entry.Size, modTime, algo); ok {
+			result[algo] = digest
+			continue
+		}
+		if h := NewHash(algo); h != nil {
+			hashers[algo] = h
+		}
+	}
+	if len(hashers) == 0 {
+		return result, nil
+	}
+
+	r, err := backend.Get(entry.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %v", err)
+	}
+	defer r.Close()
+
+	writers := make([]io.Writer, 0, len(hashers))
+	for _, h := range hashers {
+		writers = append(writers, h)
+	}
+
+	buf := hashBufPool.Get().(*[]byte)
+	defer hashBufPool.Put(buf)
+	if _, err := io.CopyBuffer(io.MultiWriter(writers...), r, *buf); err != nil {
+		return nil, fmt.Errorf("failed to copy: %v", err)
+	}
+
+	for algo, h := range hashers {
+		digest := fmt.Sprintf("%x", h.Sum(nil))
+		result[algo] = digest
+		cache.Set(entry.Name, entry.Size, modTime, algo, digest)
+	}
+	return result, nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const hashCacheFile = ".hashcache.json"
+
+// hashBufPool hands out reusable buffers for streaming a file into a
+// hash.Hash, so listing a large Downloads folder doesn't allocate a fresh
+// buffer per file per request.
+var hashBufPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 32*1024)
+		return &buf
+	},
+}
+
+// HashCache remembers file hashes keyed by (path, size, mtime, algo) so
+// listFilesAsJson doesn't have to reread and rehash every file on every
+// request. It's populated lazily and persisted to hashCacheFile so it
+// survives a restart.
+type HashCache struct {
+	backend StorageBackend
+	entries sync.Map // string (cacheKey) -> string (hex digest)
+	dirty   int32
+}
+
+func cacheKey(path string, size, modTime int64, algo string) string {
+	return fmt.Sprintf("%s|%d|%d|%s", path, size, modTime, algo)
+}
+
+// NewHashCache builds a HashCache backed by backend, loading any
+// previously persisted entries.
+func NewHashCache(backend StorageBackend) *HashCache {
+	hc := &HashCache{backend: backend}
+	hc.load()
+	return hc
+}
+
+func (hc *HashCache) load() {
+	r, err := hc.backend.Get(hashCacheFile)
+	if err != nil {
+		return
+	}
+	defer r.Close()
+
+	var raw map[string]string
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		log.Printf("failed to decode hash cache, starting empty: %v", err)
+		return
+	}
+	for k, v := range raw {
+		hc.entries.Store(k, v)
+	}
+}
+
+// Get returns a cached hash for (path, size, modTime, algo), if any.
+func (hc *HashCache) Get(path string, size, modTime int64, algo string) (string, bool) {
+	v, ok := hc.entries.Load(cacheKey(path, size, modTime, algo))
+	if !ok {
+		return "", false
+	}
+	return v.(string), true
+}
+
+// Set records a computed hash and marks the cache dirty for the next flush.
+func (hc *HashCache) Set(path string, size, modTime int64, algo, digest string) {
+	hc.entries.Store(cacheKey(path, size, modTime, algo), digest)
+	atomic.StoreInt32(&hc.dirty, 1)
+}
+
+// Reset discards every cached hash, forcing the next listing to recompute
+// from scratch. Used by the POST /?rehash=1 admin endpoint.
+func (hc *HashCache) Reset() {
+	hc.entries.Range(func(k, _ interface{}) bool {
+		hc.entries.Delete(k)
+		return true
+	})
+	atomic.StoreInt32(&hc.dirty, 1)
+	hc.flush()
+}
+
+func (hc *HashCache) flush() {
+	if atomic.SwapInt32(&hc.dirty, 0) == 0 {
+		return
+	}
+	raw := map[string]string{}
+	hc.entries.Range(func(k, v interface{}) bool {
+		raw[k.(string)] = v.(string)
+		return true
+	})
+	buf, err := json.Marshal(raw)
+	if err != nil {
+		log.Printf("failed to encode hash cache: %v", err)
+		return
+	}
+	if err := hc.backend.Put(hashCacheFile, bytes.NewReader(buf)); err != nil {
+		log.Printf("failed to flush hash cache: %v", err)
+	}
+}
+
+func (hc *HashCache) startFlushLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	for range ticker.C {
+		hc.flush()
+	}
+}
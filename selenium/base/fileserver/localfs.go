@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalFS is the StorageBackend that serves files straight off the
+// container's local disk, the behaviour this server has always had.
+type LocalFS struct {
+	dir string
+}
+
+// NewLocalFS returns a LocalFS rooted at dir.
+func NewLocalFS(dir string) *LocalFS {
+	return &LocalFS{dir: dir}
+}
+
+// path joins name onto the root dir, treating it as absolute first so a
+// "../../etc/passwd" style name can't escape the root.
+func (l *LocalFS) path(name string) string {
+	cleaned := filepath.Clean(string(filepath.Separator) + filepath.FromSlash(name))
+	return filepath.Join(l.dir, cleaned)
+}
+
+func (l *LocalFS) Put(name string, r io.Reader) error {
+	f, err := os.Create(l.path(name))
+	if err != nil {
+		return fmt.Errorf("failed to create file: %v", err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		return fmt.Errorf("failed to write file: %v", err)
+	}
+	return nil
+}
+
+func (l *LocalFS) Get(name string) (io.ReadCloser, error) {
+	f, err := os.Open(l.path(name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %v", err)
+	}
+	return f, nil
+}
+
+func (l *LocalFS) Open(name string) (io.ReadSeekCloser, error) {
+	f, err := os.Open(l.path(name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %v", err)
+	}
+	return f, nil
+}
+
+func (l *LocalFS) Exists(name string) bool {
+	_, err := os.Stat(l.path(name))
+	return err == nil
+}
+
+func (l *LocalFS) Delete(name string) error {
+	return os.Remove(l.path(name))
+}
+
+func (l *LocalFS) List() ([]FileMeta, error) {
+	entries, err := os.ReadDir(l.dir)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]FileMeta, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() || strings.HasSuffix(info.Name(), metadataSuffix) || info.Name() == hashCacheFile {
+			continue
+		}
+		files = append(files, FileMeta{
+			Name:    info.Name(),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+	}
+	return files, nil
+}
+
+func (l *LocalFS) ListRecursive(prefix string) ([]FileMeta, error) {
+	root := l.path(prefix)
+	var files []FileMeta
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if strings.HasSuffix(d.Name(), metadataSuffix) || d.Name() == hashCacheFile {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(l.dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, FileMeta{
+			Name:    filepath.ToSlash(rel),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func (l *LocalFS) Size(name string) (int64, error) {
+	info, err := os.Stat(l.path(name))
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func (l *LocalFS) ServeFile(w http.ResponseWriter, r *http.Request, name string) {
+	http.ServeFile(w, r, l.path(name))
+}
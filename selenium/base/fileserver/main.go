@@ -1,27 +1,37 @@
 package main
 
 import (
-	"crypto/md5"
-	"crypto/sha1"
-	"crypto/sha256"
 	"encoding/json"
 	"fmt"
-	"hash"
-	"io"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 )
 
 func main() {
-	dir, err := downloadsDir()
+	backend, err := NewStorageBackend()
 	if err != nil {
 		log.Fatal(err)
 	}
-	log.Fatal(http.ListenAndServe(":8080", mux(dir)))
+	go startExpirySweeper(backend, expirySweepInterval())
+
+	cache := NewHashCache(backend)
+	go cache.startFlushLoop(10 * time.Second)
+
+	log.Fatal(http.ListenAndServe(":8080", mux(backend, cache)))
+}
+
+func expirySweepInterval() time.Duration {
+	if v := os.Getenv("EXPIRY_SWEEP_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+	return time.Minute
 }
 
 func downloadsDir() (string, error) {
@@ -38,99 +48,116 @@ func downloadsDir() (string, error) {
 }
 
 const (
-	jsonParam = "json"
-	hashSum   = "hash"
+	jsonParam      = "json"
+	hashSum        = "hash"
+	recursiveParam = "recursive"
 )
 
-func mux(dir string) http.Handler {
+func mux(backend StorageBackend, cache *HashCache) http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodDelete {
-			deleteFileIfExists(w, r, dir)
+			deleteFileIfExists(w, r, backend)
+			return
+		}
+		if r.Method == http.MethodPut {
+			handleRawUpload(w, r, backend)
+			return
+		}
+		if r.Method == http.MethodPost && r.URL.Path == "/" {
+			if _, ok := r.URL.Query()["rehash"]; ok {
+				if !adminAuthorized(r) {
+					http.Error(w, "admin key required", http.StatusForbidden)
+					return
+				}
+				cache.Reset()
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+				handleMultipartUpload(w, r, backend)
+				return
+			}
+			http.Error(w, "missing file name", http.StatusBadRequest)
+			return
+		}
+		if r.Method == http.MethodPost {
+			updateMetadata(w, r, backend)
+			return
+		}
+		if _, ok := r.URL.Query()["archive"]; ok {
+			handleArchive(w, r, backend)
 			return
 		}
 		if _, ok := r.URL.Query()[jsonParam]; ok {
+			_, recursive := r.URL.Query()[recursiveParam]
 			hashSumQuery, ok := r.URL.Query()[hashSum]
 			if ok {
-				listFilesAsJson(w, dir, hashSumQuery[0])
+				listFilesAsJson(w, backend, cache, hashSumQuery[0], recursive)
 				return
 			}
-			listFilesAsJson(w, dir, "")
+			listFilesAsJson(w, backend, cache, "", recursive)
 			return
 		}
-		http.FileServer(http.Dir(dir)).ServeHTTP(w, r)
+		name := strings.TrimPrefix(r.URL.Path, "/")
+		if isReservedName(name) || !backend.Exists(name) {
+			http.NotFound(w, r)
+			return
+		}
+		recordDownload(backend, name)
+		backend.ServeFile(w, r, name)
 	})
 	return mux
 }
 
 type FileInfo struct {
-	Name         string `json:"name"`
-	Size         int64  `json:"size"`
-	LastModified int64  `json:"lastModified"`
-	HashSum      string `json:"hashSum,omitempty"`
-}
-
-func getHash(file string, algo string) (string, error) {
-	f, err := os.Open(file)
-	if err != nil {
-		return "", fmt.Errorf("failed to open file: %v", err)
-	}
-	defer f.Close()
-
-	h := NewHash(algo)
-	if h == nil {
-		return "", nil
-	}
-
-	if _, err := io.Copy(h, f); err != nil {
-		return "", fmt.Errorf("failed to copy: %v", err)
-	}
-
-	return fmt.Sprintf("%x", h.Sum(nil)), nil
+	Name          string            `json:"name"`
+	Size          int64             `json:"size"`
+	LastModified  int64             `json:"lastModified"`
+	HashSum       string            `json:"hashSum,omitempty"`
+	Hashes        map[string]string `json:"hashes,omitempty"`
+	SHA256Sum     string            `json:"sha256sum,omitempty"`
+	Mimetype      string            `json:"mimetype,omitempty"`
+	Expiry        int64             `json:"expiry,omitempty"`
+	DownloadCount int64             `json:"downloadCount,omitempty"`
 }
 
-func NewHash(algo string) hash.Hash {
-	switch strings.ToLower(algo) {
-
-	case "md5":
-		return md5.New()
-	case "sha1":
-		return sha1.New()
+func listFilesAsJson(w http.ResponseWriter, backend StorageBackend, cache *HashCache, algoList string, recursive bool) {
 
-	case "sha256":
-		return sha256.New()
-
-	default:
-		return nil
+	list := backend.List
+	if recursive {
+		list = func() ([]FileMeta, error) { return backend.ListRecursive("") }
 	}
-}
-
-func listFilesAsJson(w http.ResponseWriter, dir string, algo string) {
-
-	entries, err := os.ReadDir(dir)
+	entries, err := list()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	files := make([]FileInfo, 0, len(entries))
 	for _, entry := range entries {
-		info, err := entry.Info()
+		hashes, err := getHashes(backend, cache, entry, algoList)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-
-		hashFile, err := getHash(dir+"/"+entry.Name(), algo)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+		info := FileInfo{
+			Name:         entry.Name,
+			Size:         entry.Size,
+			LastModified: entry.ModTime.Unix(),
+			Hashes:       hashes,
+		}
+		// Keep the old single-value field populated for clients that only
+		// ever asked for one algorithm and never learned about "hashes".
+		if algos := splitAlgos(algoList); len(algos) == 1 {
+			info.HashSum = hashes[algos[0]]
 		}
-		files = append(files, FileInfo{
-			Name:         info.Name(),
-			Size:         info.Size(),
-			LastModified: info.ModTime().Unix(),
-			HashSum:      hashFile,
-		})
+		if m, err := loadMetadata(backend, entry.Name); err == nil {
+			info.SHA256Sum = m.SHA256Sum
+			info.Mimetype = m.Mimetype
+			info.Expiry = m.Expiry
+			info.DownloadCount = m.DownloadCount
+		}
+		files = append(files, info)
 	}
 
 	sort.Slice(files, func(i, j int) bool {
@@ -141,17 +168,50 @@ func listFilesAsJson(w http.ResponseWriter, dir string, algo string) {
 	_ = json.NewEncoder(w).Encode(files)
 }
 
-func deleteFileIfExists(w http.ResponseWriter, r *http.Request, dir string) {
+func deleteFileIfExists(w http.ResponseWriter, r *http.Request, backend StorageBackend) {
 	fileName := strings.TrimPrefix(r.URL.Path, "/")
-	filePath := filepath.Join(dir, fileName)
-	_, err := os.Stat(filePath)
-	if err != nil {
+	if !backend.Exists(fileName) {
 		http.Error(w, fmt.Sprintf("Unknown file %s", fileName), http.StatusNotFound)
 		return
 	}
-	err = os.Remove(filePath)
+
+	unlock := lockMetadata(fileName)
+	defer unlock()
+
+	// getOrCreateMetadata, not loadMetadata: a file nobody has POSTed to
+	// yet (the common case for something the browser just downloaded)
+	// still needs a delete_key minted before we decide whether to allow
+	// the delete, otherwise it'd be open to anyone.
+	m, err := getOrCreateMetadata(backend, fileName)
 	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !authorizedToDelete(r, m) {
+		http.Error(w, "delete_key required", http.StatusForbidden)
+		return
+	}
+
+	if err := backend.Delete(fileName); err != nil {
 		http.Error(w, fmt.Sprintf("Failed to delete file %s: %v", fileName, err), http.StatusInternalServerError)
 		return
 	}
+	_ = backend.Delete(metadataName(fileName))
+}
+
+// recordDownload bumps the download counter for name, creating its
+// metadata sidecar on first serve if it doesn't exist yet.
+func recordDownload(backend StorageBackend, name string) {
+	unlock := lockMetadata(name)
+	defer unlock()
+
+	m, err := getOrCreateMetadata(backend, name)
+	if err != nil {
+		log.Printf("failed to load metadata for %s: %v", name, err)
+		return
+	}
+	m.DownloadCount++
+	if err := saveMetadata(backend, name, m); err != nil {
+		log.Printf("failed to record download of %s: %v", name, err)
+	}
 }
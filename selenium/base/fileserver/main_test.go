@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRehashRequiresAdminKey(t *testing.T) {
+	backend := NewLocalFS(t.TempDir())
+	cache := NewHashCache(backend)
+	handler := mux(backend, cache)
+
+	t.Setenv("ADMIN_KEY", "s3cr3t")
+
+	r := httptest.NewRequest(http.MethodPost, "/?rehash", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("unauthenticated rehash: status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/?rehash", nil)
+	r.Header.Set(adminHeader, "wrong")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("rehash with wrong admin key: status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/?rehash", nil)
+	r.Header.Set(adminHeader, "s3cr3t")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("rehash with correct admin key: status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestGetRejectsReservedNames(t *testing.T) {
+	backend := NewLocalFS(t.TempDir())
+	cache := NewHashCache(backend)
+	handler := mux(backend, cache)
+
+	if _, _, err := storeUpload(backend, "secret.txt", strings.NewReader("payload")); err != nil {
+		t.Fatalf("storeUpload() error = %v", err)
+	}
+
+	// The sidecar was written directly by saveMetadata, bypassing
+	// storeUpload's reserved-name check, so it exists on the backend the
+	// same way it would for any uploaded file.
+	r := httptest.NewRequest(http.MethodGet, "/secret.txt.metadata.json", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GET of metadata sidecar: status = %d, want %d (body: %s)", w.Code, http.StatusNotFound, w.Body)
+	}
+	if strings.Contains(w.Body.String(), "delete_key") {
+		t.Errorf("GET of metadata sidecar leaked delete_key: %s", w.Body)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/"+hashCacheFile, nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GET of hash cache: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	// An ordinary file is unaffected.
+	r = httptest.NewRequest(http.MethodGet, "/secret.txt", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("GET of ordinary file: status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestRehashUnreachableWithoutAdminKeyConfigured(t *testing.T) {
+	backend := NewLocalFS(t.TempDir())
+	cache := NewHashCache(backend)
+	handler := mux(backend, cache)
+
+	t.Setenv("ADMIN_KEY", "")
+
+	r := httptest.NewRequest(http.MethodPost, "/?rehash", nil)
+	r.Header.Set(adminHeader, "anything")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("rehash with no ADMIN_KEY configured: status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
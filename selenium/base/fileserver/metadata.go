@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const metadataSuffix = ".metadata.json"
+
+// Metadata is the sidecar record kept next to every downloaded file,
+// stored under name+metadataSuffix in the same StorageBackend.
+type Metadata struct {
+	SHA256Sum     string `json:"sha256sum"`
+	Mimetype      string `json:"mimetype"`
+	Size          int64  `json:"size"`
+	Expiry        int64  `json:"expiry"`
+	DeleteKey     string `json:"delete_key,omitempty"`
+	DownloadCount int64  `json:"download_count"`
+}
+
+func metadataName(name string) string {
+	return name + metadataSuffix
+}
+
+func loadMetadata(backend StorageBackend, name string) (*Metadata, error) {
+	r, err := backend.Get(metadataName(name))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var m Metadata
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, fmt.Errorf("failed to decode metadata for %s: %v", name, err)
+	}
+	return &m, nil
+}
+
+func saveMetadata(backend StorageBackend, name string, m *Metadata) error {
+	buf, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata for %s: %v", name, err)
+	}
+	return backend.Put(metadataName(name), bytes.NewReader(buf))
+}
+
+// newMetadata builds a fresh Metadata record for name by sniffing the mime
+// type off the first 512 bytes and hashing the whole file in one pass.
+func newMetadata(backend StorageBackend, name string) (*Metadata, error) {
+	r, err := backend.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	peek := make([]byte, 512)
+	n, err := io.ReadFull(r, peek)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, fmt.Errorf("failed to read %s: %v", name, err)
+	}
+	peek = peek[:n]
+
+	h := sha256.New()
+	h.Write(peek)
+	size := int64(n)
+	if written, err := io.Copy(h, r); err != nil {
+		return nil, fmt.Errorf("failed to hash %s: %v", name, err)
+	} else {
+		size += written
+	}
+
+	return &Metadata{
+		SHA256Sum: fmt.Sprintf("%x", h.Sum(nil)),
+		Mimetype:  http.DetectContentType(peek),
+		Size:      size,
+		DeleteKey: randomDeleteKey(),
+	}, nil
+}
+
+// metadataLocks holds one *sync.Mutex per file name, so the read-modify-write
+// sequences in getOrCreateMetadata, recordDownload and updateMetadata
+// serialize instead of racing each other (two concurrent first-time
+// requests minting two different delete_keys, or a lost download-count
+// increment). Callers doing such a sequence must hold the lock for its
+// whole duration, not just the individual load/save calls.
+var metadataLocks sync.Map
+
+// lockMetadata acquires the per-name mutex for name, creating it on first
+// use, and returns a function that releases it.
+func lockMetadata(name string) func() {
+	v, _ := metadataLocks.LoadOrStore(name, &sync.Mutex{})
+	mu := v.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
+
+// getOrCreateMetadata returns the metadata sidecar for name, creating and
+// persisting one (with a fresh delete key) the first time it's requested.
+// Callers that need this to be atomic with respect to other metadata
+// read-modify-write operations on name must hold lockMetadata(name) first.
+func getOrCreateMetadata(backend StorageBackend, name string) (*Metadata, error) {
+	if m, err := loadMetadata(backend, name); err == nil {
+		return m, nil
+	}
+	m, err := newMetadata(backend, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := saveMetadata(backend, name, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func randomDeleteKey() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		// crypto/rand failing is effectively unrecoverable; fall back to a
+		// predictable-but-non-empty key rather than panicking the server.
+		return fmt.Sprintf("fallback-%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
+
+const adminHeader = "X-Admin-Key"
+
+// constantTimeEqual compares two secrets without leaking timing
+// information about how much of a guess matched.
+func constantTimeEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// adminAuthorized reports whether r carries the configured ADMIN_KEY.
+// With no ADMIN_KEY set, admin-gated actions are unreachable by anyone.
+func adminAuthorized(r *http.Request) bool {
+	adminKey := os.Getenv("ADMIN_KEY")
+	if adminKey == "" {
+		return false
+	}
+	return constantTimeEqual(r.Header.Get(adminHeader), adminKey)
+}
+
+// authorizedToDelete reports whether r may delete (or otherwise mutate)
+// a file whose metadata is m. Every file gets a delete key the first
+// time its metadata is created (see getOrCreateMetadata), so a missing
+// key is treated as deny, not as "no auth needed".
+func authorizedToDelete(r *http.Request, m *Metadata) bool {
+	if m.DeleteKey == "" {
+		return false
+	}
+	if key := r.URL.Query().Get("delete_key"); key != "" && constantTimeEqual(key, m.DeleteKey) {
+		return true
+	}
+	return adminAuthorized(r)
+}
+
+// updateMetadata handles POST /<name>?delete_key=<key>&expiry=<unix> and
+// POST /<name>?delete_key=<key>&refresh_delete_key=1, refreshing the
+// expiry and/or delete key of an existing file. The caller must present
+// the file's current delete_key (or ADMIN_KEY) to mutate anything; a file
+// that has never had a delete_key minted can only be initialized by an
+// admin, since there's no existing owner to authenticate against yet.
+func updateMetadata(w http.ResponseWriter, r *http.Request, backend StorageBackend) {
+	fileName := strings.TrimPrefix(r.URL.Path, "/")
+	if !backend.Exists(fileName) {
+		http.Error(w, fmt.Sprintf("Unknown file %s", fileName), http.StatusNotFound)
+		return
+	}
+
+	unlock := lockMetadata(fileName)
+	defer unlock()
+
+	m, err := loadMetadata(backend, fileName)
+	if err != nil {
+		if !adminAuthorized(r) {
+			http.Error(w, "delete_key required", http.StatusForbidden)
+			return
+		}
+		if m, err = newMetadata(backend, fileName); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	} else if !authorizedToDelete(r, m) {
+		http.Error(w, "delete_key required", http.StatusForbidden)
+		return
+	}
+
+	if v := r.URL.Query().Get("expiry"); v != "" {
+		expiry, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid expiry %q: %v", v, err), http.StatusBadRequest)
+			return
+		}
+		m.Expiry = expiry
+	}
+	refreshed := false
+	if _, ok := r.URL.Query()["refresh_delete_key"]; ok {
+		m.DeleteKey = randomDeleteKey()
+		refreshed = true
+	}
+
+	if err := saveMetadata(backend, fileName, m); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Never echo the delete_key back except to the caller who just
+	// (re)generated it — otherwise anyone who can POST a filename gets
+	// the current owner's key for free.
+	resp := *m
+	if !refreshed {
+		resp.DeleteKey = ""
+	}
+	w.Header().Add("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// sweepExpiredFiles deletes every file (and its metadata sidecar) whose
+// expiry has passed. It's run on a timer from main so shares live forever
+// by default (expiry == 0) unless a client has set one.
+func sweepExpiredFiles(backend StorageBackend) {
+	entries, err := backend.ListRecursive("")
+	if err != nil {
+		log.Printf("expiry sweep: failed to list files: %v", err)
+		return
+	}
+	now := time.Now().Unix()
+	for _, entry := range entries {
+		m, err := loadMetadata(backend, entry.Name)
+		if err != nil || m.Expiry == 0 || m.Expiry > now {
+			continue
+		}
+		if err := backend.Delete(entry.Name); err != nil {
+			log.Printf("expiry sweep: failed to delete %s: %v", entry.Name, err)
+			continue
+		}
+		if err := backend.Delete(metadataName(entry.Name)); err != nil {
+			log.Printf("expiry sweep: failed to delete metadata for %s: %v", entry.Name, err)
+		}
+	}
+}
+
+func startExpirySweeper(backend StorageBackend, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	for range ticker.C {
+		sweepExpiredFiles(backend)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestAuthorizedToDelete(t *testing.T) {
+	m := &Metadata{DeleteKey: "correct-horse"}
+
+	cases := []struct {
+		name      string
+		m         *Metadata
+		query     string
+		adminKey  string
+		header    string
+		authorize bool
+	}{
+		{name: "correct delete_key", m: m, query: "?delete_key=correct-horse", authorize: true},
+		{name: "wrong delete_key", m: m, query: "?delete_key=wrong", authorize: false},
+		{name: "no delete_key, no admin key configured", m: m, authorize: false},
+		{name: "admin header with matching ADMIN_KEY", m: m, adminKey: "s3cr3t", header: "s3cr3t", authorize: true},
+		{name: "admin header with wrong ADMIN_KEY", m: m, adminKey: "s3cr3t", header: "wrong", authorize: false},
+		{name: "file with no delete_key ever minted is always denied", m: &Metadata{}, adminKey: "s3cr3t", header: "s3cr3t", authorize: false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.adminKey != "" {
+				t.Setenv("ADMIN_KEY", tc.adminKey)
+			} else {
+				t.Setenv("ADMIN_KEY", "")
+			}
+
+			r := httptest.NewRequest(http.MethodDelete, "/file.txt"+tc.query, nil)
+			if tc.header != "" {
+				r.Header.Set(adminHeader, tc.header)
+			}
+
+			if got := authorizedToDelete(r, tc.m); got != tc.authorize {
+				t.Errorf("authorizedToDelete() = %v, want %v", got, tc.authorize)
+			}
+		})
+	}
+}
+
+func TestAdminAuthorized(t *testing.T) {
+	t.Setenv("ADMIN_KEY", "s3cr3t")
+
+	r := httptest.NewRequest(http.MethodPost, "/?rehash", nil)
+	if adminAuthorized(r) {
+		t.Error("adminAuthorized() = true for request with no admin header, want false")
+	}
+
+	r.Header.Set(adminHeader, "s3cr3t")
+	if !adminAuthorized(r) {
+		t.Error("adminAuthorized() = false for request with matching admin header, want true")
+	}
+}
+
+func TestGetOrCreateMetadataConcurrentIsSerializedByLock(t *testing.T) {
+	backend := NewLocalFS(t.TempDir())
+	if err := backend.Put("race.txt", strings.NewReader("payload")); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	const concurrency = 20
+	keys := make([]string, concurrency)
+	var wg sync.WaitGroup
+	wg.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func(i int) {
+			defer wg.Done()
+			unlock := lockMetadata("race.txt")
+			defer unlock()
+			m, err := getOrCreateMetadata(backend, "race.txt")
+			if err != nil {
+				t.Errorf("getOrCreateMetadata() error = %v", err)
+				return
+			}
+			keys[i] = m.DeleteKey
+		}(i)
+	}
+	wg.Wait()
+
+	for i, k := range keys {
+		if k == "" {
+			t.Fatalf("goroutine %d got an empty delete_key", i)
+		}
+		if k != keys[0] {
+			t.Errorf("goroutine %d minted delete_key %q, want %q (concurrent first-time metadata creation was not serialized)", i, k, keys[0])
+		}
+	}
+}
+
+func TestAdminAuthorizedNoKeyConfigured(t *testing.T) {
+	t.Setenv("ADMIN_KEY", "")
+
+	r := httptest.NewRequest(http.MethodPost, "/?rehash", nil)
+	r.Header.Set(adminHeader, "anything")
+	if adminAuthorized(r) {
+		t.Error("adminAuthorized() = true with no ADMIN_KEY configured, want false")
+	}
+}
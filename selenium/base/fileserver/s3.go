@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// S3Backend is the StorageBackend that keeps downloaded files in an S3
+// bucket (or an S3-compatible endpoint such as MinIO) instead of on disk.
+type S3Backend struct {
+	client *s3.Client
+	bucket string
+}
+
+// NewS3Backend builds an S3Backend from S3_BUCKET, S3_REGION and the
+// optional S3_ENDPOINT env vars.
+func NewS3Backend() (*S3Backend, error) {
+	bucket := os.Getenv("S3_BUCKET")
+	if bucket == "" {
+		return nil, fmt.Errorf("S3_BUCKET must be set when STORAGE_BACKEND=s3")
+	}
+
+	opts := []func(*config.LoadOptions) error{}
+	if region := os.Getenv("S3_REGION"); region != "" {
+		opts = append(opts, config.WithRegion(region))
+	}
+	cfg, err := config.LoadDefaultConfig(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %v", err)
+	}
+
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if endpoint := os.Getenv("S3_ENDPOINT"); endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+			o.UsePathStyle = true
+		}
+	})
+
+	return &S3Backend{client: client, bucket: bucket}, nil
+}
+
+func (s *S3Backend) Put(name string, r io.Reader) error {
+	_, err := s.client.PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(name),
+		Body:   r,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put object %s: %v", name, err)
+	}
+	return nil
+}
+
+func (s *S3Backend) Get(name string) (io.ReadCloser, error) {
+	out, err := s.client.GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(name),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object %s: %v", name, err)
+	}
+	return out.Body, nil
+}
+
+// Open behaves like Get since S3 objects don't support efficient seeking
+// without re-requesting a byte range; callers that need http.ServeContent
+// semantics get that via ServeFile instead.
+func (s *S3Backend) Open(name string) (io.ReadSeekCloser, error) {
+	return nil, fmt.Errorf("seekable open is not supported by the s3 backend")
+}
+
+func (s *S3Backend) Exists(name string) bool {
+	_, err := s.client.HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(name),
+	})
+	return err == nil
+}
+
+func (s *S3Backend) Delete(name string) error {
+	_, err := s.client.DeleteObject(context.Background(), &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(name),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete object %s: %v", name, err)
+	}
+	return nil
+}
+
+func (s *S3Backend) List() ([]FileMeta, error) {
+	var files []FileMeta
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects: %v", err)
+		}
+		for _, obj := range page.Contents {
+			key := aws.ToString(obj.Key)
+			if strings.HasSuffix(key, metadataSuffix) || key == hashCacheFile {
+				continue
+			}
+			files = append(files, FileMeta{
+				Name:    aws.ToString(obj.Key),
+				Size:    aws.ToInt64(obj.Size),
+				ModTime: aws.ToTime(obj.LastModified),
+			})
+		}
+	}
+	return files, nil
+}
+
+// ListRecursive lists every object under prefix. S3 keys are already a
+// flat namespace, so this is List with a server-side prefix filter.
+func (s *S3Backend) ListRecursive(prefix string) ([]FileMeta, error) {
+	var files []FileMeta
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects: %v", err)
+		}
+		for _, obj := range page.Contents {
+			key := aws.ToString(obj.Key)
+			if strings.HasSuffix(key, metadataSuffix) || key == hashCacheFile {
+				continue
+			}
+			files = append(files, FileMeta{
+				Name:    key,
+				Size:    aws.ToInt64(obj.Size),
+				ModTime: aws.ToTime(obj.LastModified),
+			})
+		}
+	}
+	return files, nil
+}
+
+func (s *S3Backend) Size(name string) (int64, error) {
+	out, err := s.client.HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(name),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to head object %s: %v", name, err)
+	}
+	return aws.ToInt64(out.ContentLength), nil
+}
+
+func (s *S3Backend) ServeFile(w http.ResponseWriter, r *http.Request, name string) {
+	body, err := s.Get(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	defer body.Close()
+
+	if _, err := io.Copy(w, body); err != nil {
+		log.Printf("failed to stream %s from s3: %v", name, err)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// FileMeta describes a single object stored in a StorageBackend, independent
+// of whether that object lives on local disk or in an object store.
+type FileMeta struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+}
+
+// StorageBackend abstracts the place downloaded files are kept so the
+// handlers in main.go don't need to know whether they're talking to the
+// container's local disk or a remote object store.
+type StorageBackend interface {
+	Put(name string, r io.Reader) error
+	Get(name string) (io.ReadCloser, error)
+	Open(name string) (io.ReadSeekCloser, error)
+	Exists(name string) bool
+	Delete(name string) error
+	List() ([]FileMeta, error)
+	// ListRecursive lists every file whose name has the given prefix,
+	// descending into subdirectories. An empty prefix lists everything.
+	ListRecursive(prefix string) ([]FileMeta, error)
+	Size(name string) (int64, error)
+	ServeFile(w http.ResponseWriter, r *http.Request, name string)
+}
+
+// NewStorageBackend builds the StorageBackend selected by the
+// STORAGE_BACKEND env var ("local" or "s3", defaulting to "local").
+func NewStorageBackend() (StorageBackend, error) {
+	switch strings.ToLower(os.Getenv("STORAGE_BACKEND")) {
+	case "", "local", "localfs":
+		dir, err := downloadsDir()
+		if err != nil {
+			return nil, err
+		}
+		return NewLocalFS(dir), nil
+	case "s3":
+		return NewS3Backend()
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_BACKEND %q", os.Getenv("STORAGE_BACKEND"))
+	}
+}
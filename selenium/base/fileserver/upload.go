@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const defaultMaxUploadBytes = 100 << 20 // 100MiB
+
+func maxUploadBytes() int64 {
+	if v := os.Getenv("MAX_UPLOAD_BYTES"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
+			return n
+		}
+	}
+	return defaultMaxUploadBytes
+}
+
+type uploadResponse struct {
+	Name      string `json:"name"`
+	Size      int64  `json:"size"`
+	SHA256    string `json:"sha256"`
+	URL       string `json:"url"`
+	DeleteKey string `json:"delete_key"`
+}
+
+// handleMultipartUpload serves POST / with a multipart/form-data body
+// whose file field is named "file", mirroring the pomf/gomf convention.
+func handleMultipartUpload(w http.ResponseWriter, r *http.Request, backend StorageBackend) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadBytes())
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			http.Error(w, "missing \"file\" form field", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			respondUploadError(w, err)
+			return
+		}
+		if part.FormName() != "file" {
+			continue
+		}
+
+		name, m, err := storeUpload(backend, part.FileName(), part)
+		if err != nil {
+			respondUploadError(w, err)
+			return
+		}
+		respondUpload(w, name, m)
+		return
+	}
+}
+
+// handleRawUpload serves PUT /<name>, writing the request body straight
+// to disk under a sanitized version of name.
+func handleRawUpload(w http.ResponseWriter, r *http.Request, backend StorageBackend) {
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	if name == "" {
+		http.Error(w, "missing file name", http.StatusBadRequest)
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxUploadBytes())
+	stored, m, err := storeUpload(backend, name, body)
+	if err != nil {
+		respondUploadError(w, err)
+		return
+	}
+	respondUpload(w, stored, m)
+}
+
+// storeUpload sniffs the mime type from the first 512 bytes of r, streams
+// the rest to backend while hashing it in the same pass, and persists the
+// resulting metadata. It returns the (possibly renamed) stored file name.
+func storeUpload(backend StorageBackend, rawName string, r io.Reader) (string, *Metadata, error) {
+	sanitized := sanitizeFilename(rawName)
+	if isReservedName(sanitized) {
+		return "", nil, fmt.Errorf("%q is a reserved name", sanitized)
+	}
+	name := uniqueName(backend, sanitized)
+
+	peek := make([]byte, 512)
+	n, err := io.ReadFull(r, peek)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", nil, fmt.Errorf("failed to read upload: %v", err)
+	}
+	peek = peek[:n]
+	mimetype := http.DetectContentType(peek)
+
+	h := sha256.New()
+	counter := &countingReader{r: io.MultiReader(bytes.NewReader(peek), r)}
+	if err := backend.Put(name, io.TeeReader(counter, h)); err != nil {
+		return "", nil, fmt.Errorf("failed to store upload: %v", err)
+	}
+
+	m := &Metadata{
+		SHA256Sum: fmt.Sprintf("%x", h.Sum(nil)),
+		Mimetype:  mimetype,
+		Size:      counter.n,
+		DeleteKey: randomDeleteKey(),
+	}
+	if err := saveMetadata(backend, name, m); err != nil {
+		return "", nil, err
+	}
+	return name, m, nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// sanitizeFilename strips directory components and anything else that
+// would let an upload escape the downloads dir, falling back to a random
+// name if nothing usable is left.
+func sanitizeFilename(name string) string {
+	name = filepath.Base(filepath.Clean("/" + name))
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == string(filepath.Separator) {
+		return randomID()
+	}
+	return name
+}
+
+// isReservedName reports whether name collides with the metadata sidecar
+// or hash cache namespace, both of which share the flat key space with
+// real files (see the same check in List/ListRecursive). Uploads must be
+// rejected here regardless of whether name currently exists, otherwise a
+// PUT of e.g. "victim.txt.metadata.json" can forge another file's
+// metadata, including its delete_key, before that file has one of its own.
+func isReservedName(name string) bool {
+	return strings.HasSuffix(name, metadataSuffix) || name == hashCacheFile
+}
+
+// uniqueName appends a short random suffix to name if it (or its
+// metadata sidecar) already exists, so uploads never clobber each other.
+func uniqueName(backend StorageBackend, name string) string {
+	if !backend.Exists(name) {
+		return name
+	}
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 0; i < 100; i++ {
+		candidate := fmt.Sprintf("%s-%s%s", base, randomID(), ext)
+		if !backend.Exists(candidate) {
+			return candidate
+		}
+	}
+	return fmt.Sprintf("%s-%s%s", base, randomID(), ext)
+}
+
+func randomID() string {
+	buf := make([]byte, 4)
+	if _, err := rand.Read(buf); err != nil {
+		return "upload"
+	}
+	return hex.EncodeToString(buf)
+}
+
+func respondUpload(w http.ResponseWriter, name string, m *Metadata) {
+	w.Header().Add("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(uploadResponse{
+		Name:      name,
+		Size:      m.Size,
+		SHA256:    m.SHA256Sum,
+		URL:       "/" + name,
+		DeleteKey: m.DeleteKey,
+	})
+}
+
+func respondUploadError(w http.ResponseWriter, err error) {
+	if strings.Contains(err.Error(), "too large") {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if strings.Contains(err.Error(), "reserved name") {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
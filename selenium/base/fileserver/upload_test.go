@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStoreUploadRejectsReservedNames(t *testing.T) {
+	backend := NewLocalFS(t.TempDir())
+
+	cases := []string{
+		"victim.txt.metadata.json",
+		".hashcache.json",
+		"../victim.txt.metadata.json",
+	}
+
+	for _, name := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := storeUpload(backend, name, strings.NewReader("payload"))
+			if err == nil {
+				t.Fatalf("storeUpload(%q) succeeded, want error", name)
+			}
+			if !strings.Contains(err.Error(), "reserved name") {
+				t.Errorf("storeUpload(%q) error = %v, want a reserved name error", name, err)
+			}
+		})
+	}
+
+	// The reserved names must never have been written to the backend.
+	if backend.Exists(hashCacheFile) {
+		t.Errorf("%s was created despite being rejected", hashCacheFile)
+	}
+	if backend.Exists("victim.txt.metadata.json") {
+		t.Error("victim.txt.metadata.json was created despite being rejected")
+	}
+}
+
+func TestStoreUploadOrdinaryName(t *testing.T) {
+	backend := NewLocalFS(t.TempDir())
+
+	name, m, err := storeUpload(backend, "victim.txt", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatalf("storeUpload() error = %v", err)
+	}
+	if name != "victim.txt" {
+		t.Errorf("storeUpload() name = %q, want %q", name, "victim.txt")
+	}
+	if m.DeleteKey == "" {
+		t.Error("storeUpload() produced a Metadata with no delete_key")
+	}
+}
+
+func TestIsReservedName(t *testing.T) {
+	tests := []struct {
+		name     string
+		reserved bool
+	}{
+		{"victim.txt", false},
+		{"victim.txt.metadata.json", true},
+		{".hashcache.json", true},
+		{"hashcache.json", false},
+		{"metadata.json", false},
+	}
+	for _, tc := range tests {
+		if got := isReservedName(tc.name); got != tc.reserved {
+			t.Errorf("isReservedName(%q) = %v, want %v", tc.name, got, tc.reserved)
+		}
+	}
+}